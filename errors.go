@@ -0,0 +1,112 @@
+package fcm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors returned by Client.Send and V1Client.Send. Use errors.Is
+// to test for them even when wrapped.
+var (
+	ErrBadRequest       = errors.New("fcm: bad request")
+	ErrUnauthorized     = errors.New("fcm: unauthorized")
+	ErrQuotaExceeded    = errors.New("fcm: quota exceeded")
+	ErrRetriesExhausted = errors.New("fcm: retries exhausted")
+)
+
+// PerTokenError describes the outcome FCM reported for a single token or
+// RegistrationId. Client and TopicManager return these, inside a MultiError,
+// for tokens whose error is neither retry-worthy nor delete-worthy.
+// V1Client.Send returns one for an INVALID_ARGUMENT token and for an
+// UNREGISTERED token, the latter after removing it from the Store.
+type PerTokenError struct {
+	RegID     string
+	Code      string
+	Retryable bool
+}
+
+func (e *PerTokenError) Error() string {
+	return fmt.Sprintf("fcm: %s: %s", e.RegID, e.Code)
+}
+
+// Is reports whether target is the sentinel error matching e's Code, so
+// callers can write errors.Is(err, fcm.ErrQuotaExceeded) without needing to
+// know the exact FCM error string.
+func (e *PerTokenError) Is(target error) bool {
+	switch e.Code {
+	case "MessageRateExceeded", "DeviceMessageRateExceeded",
+		"TopicsMessageRateExceeded", "QUOTA_EXCEEDED":
+		return target == ErrQuotaExceeded
+	}
+	return false
+}
+
+// MultiError is returned alongside a partial HttpResponse when some tokens
+// in a batch succeeded and others failed with an error Client couldn't
+// classify as retry-worthy or delete-worthy, so callers can inspect
+// per-RegistrationId outcomes instead of only seeing the aggregate
+// HttpResponse.
+type MultiError struct {
+	Errors []*PerTokenError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, pe := range e.Errors {
+		msgs[i] = pe.Error()
+	}
+	return fmt.Sprintf("fcm: %d token(s) failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Is reports whether target matches any of e's per-token errors.
+func (e *MultiError) Is(target error) bool {
+	for _, pe := range e.Errors {
+		if errors.Is(pe, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenErrorClass is how processResp should react to a per-token FCM error
+// code.
+type tokenErrorClass int
+
+const (
+	// classRetry means the token should be retried in a subsequent attempt.
+	classRetry tokenErrorClass = iota
+	// classDelete means the token is permanently invalid and should be
+	// removed from the Store.
+	classDelete
+	// classSurface means the error is neither retry-worthy nor
+	// delete-worthy and should be surfaced to the caller as a
+	// PerTokenError instead.
+	classSurface
+)
+
+// fcmErrorCodes classifies the FCM HTTP legacy API error catalog. Codes not
+// present here are treated conservatively as classSurface, since silently
+// deleting a token on an error we don't recognize risks losing a valid
+// registration.
+var fcmErrorCodes = map[string]tokenErrorClass{
+	"Unavailable":         classRetry,
+	"InternalServerError": classRetry,
+
+	"MismatchSenderId":    classDelete,
+	"InvalidRegistration": classDelete,
+	"NotRegistered":       classDelete,
+	"InvalidPackageName":  classDelete,
+	"MissingRegistration": classDelete,
+
+	"MessageRateExceeded":       classSurface,
+	"DeviceMessageRateExceeded": classSurface,
+	"TopicsMessageRateExceeded": classSurface,
+}
+
+func classifyError(code string) tokenErrorClass {
+	if class, ok := fcmErrorCodes[code]; ok {
+		return class
+	}
+	return classSurface
+}
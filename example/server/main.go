@@ -32,26 +32,32 @@ func main() {
 	store := NewMemStore()
 
 	fcmClient := fcm.NewDefaultClient(*fcmApiKey, store)
-	server := NewServer(fcmClient, store)
+	topicManager := fcm.NewTopicManager(*fcmApiKey, http.DefaultClient, store, nil)
+	server := NewServer(fcmClient, topicManager, store)
 	logger.Noticef("Server started listening on %s", *address)
 	logger.Error(http.ListenAndServe(*address, server))
 }
 
 type Server struct {
-	fcmClient fcm.FcmClient
-	store     *MemStore
+	fcmClient    fcm.FcmClient
+	topicManager *fcm.TopicManager
+	store        *MemStore
 	http.Handler
 }
 
-func NewServer(fcmClient fcm.FcmClient, store *MemStore) *Server {
+func NewServer(fcmClient fcm.FcmClient, topicManager *fcm.TopicManager,
+	store *MemStore) *Server {
 	s := &Server{
-		fcmClient: fcmClient,
-		store:     store,
+		fcmClient:    fcmClient,
+		topicManager: topicManager,
+		store:        store,
 	}
 	mux := http.NewServeMux()
 	mux.Handle("/simple", http.HandlerFunc(s.simple))
 	mux.Handle("/add", http.HandlerFunc(s.add))
 	mux.Handle("/message", http.HandlerFunc(s.message))
+	mux.Handle("/subscribe", http.HandlerFunc(s.subscribe))
+	mux.Handle("/unsubscribe", http.HandlerFunc(s.unsubscribe))
 	s.Handler = mux
 	return s
 }
@@ -108,6 +114,40 @@ func (s *Server) message(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
+// Subscribe every stored registration id to a topic
+// curl localhost:8080/subscribe -d "topic=news"
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topic := r.PostFormValue("topic")
+	ctx := context.TODO()
+	if err := s.topicManager.Subscribe(ctx, topic, s.store.List()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+// Unsubscribe every stored registration id from a topic
+// curl localhost:8080/unsubscribe -d "topic=news"
+func (s *Server) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topic := r.PostFormValue("topic")
+	ctx := context.TODO()
+	if err := s.topicManager.Unsubscribe(ctx, topic, s.store.List()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(200)
+}
+
 type MemStore struct {
 	regIds map[string]bool
 }
@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/spacemonkeygo/errors"
-	"github.com/spacemonkeygo/spacelog"
 )
 
 const (
@@ -21,14 +20,12 @@ const (
 )
 
 var (
-	nowHook   = time.Now   // for testing
-	sleepHook = time.Sleep // for testing
-	logger    = spacelog.GetLogger()
-	Error     = errors.NewClass("fcm")
+	nowHook = time.Now // for testing
+	Error   = errors.NewClass("fcm")
 )
 
 type FcmClient interface {
-	Send(ctx context.Context, m HttpMessage) error
+	Send(ctx context.Context, m HttpMessage) (*HttpResponse, error)
 }
 
 type HttpClient interface {
@@ -54,6 +51,18 @@ type ClientOptions struct {
 	MinBackoff       time.Duration
 	MaxBackoff       time.Duration
 	MaxRetryAttempts int
+	// RetryPolicy decides whether and how long to back off between
+	// attempts. Defaults to an ExponentialJitterPolicy built from
+	// MinBackoff/MaxBackoff.
+	RetryPolicy RetryPolicy
+
+	// OnRequest, if set, is called immediately before each outbound request.
+	OnRequest func(ctx context.Context, req RequestLog)
+	// OnResponse, if set, is called after each response is read and decoded.
+	OnResponse func(ctx context.Context, resp ResponseLog)
+	// OnRetry, if set, is called whenever Send is about to back off and
+	// retry after a failed attempt.
+	OnRetry func(ctx context.Context, attempt int, backoff time.Duration, lastErr error)
 }
 
 func DefaultClientOptions() *ClientOptions {
@@ -61,6 +70,7 @@ func DefaultClientOptions() *ClientOptions {
 		MinBackoff:       defaultMinBackoff,
 		MaxBackoff:       defaultMaxBackoff,
 		MaxRetryAttempts: defaultMaxRetryAttempts,
+		RetryPolicy:      NewExponentialJitterPolicy(defaultMinBackoff, defaultMaxBackoff),
 	}
 }
 
@@ -74,6 +84,9 @@ func NewFcmClient(apiKey string, client HttpClient, store Store,
 	if options == nil {
 		options = DefaultClientOptions()
 	}
+	if options.RetryPolicy == nil {
+		options.RetryPolicy = NewExponentialJitterPolicy(options.MinBackoff, options.MaxBackoff)
+	}
 
 	return &Client{
 		apiKey:  apiKey,
@@ -98,141 +111,128 @@ func NewHttpMessage(registrationIds []string, data Data, notif *Notification) *H
 	}
 }
 
-// Sends HttpMessages, retries with exponential backoff, processes replies to the Store
+// Sends HttpMessages, retries according to the configured RetryPolicy, and
+// processes replies to the Store.
 func (c *Client) Send(ctx context.Context, m HttpMessage) (hr *HttpResponse,
 	err error) {
 	registrationIds := m.RegistrationIds
+	policy := c.options.RetryPolicy
+	correlationID := newCorrelationID()
 
 	var resp *response
-	// Backoff to use when there is no retryAfter header
-	currentBackoff := c.options.MinBackoff
-Loop:
-	for attempts := 1; ; {
-		resp, err = c.send(&m)
-		if err != nil {
-			return nil, Error.Wrap(fmt.Errorf("error sending request to FCM HTTP"+
-				" server: %v", err))
+	var surfaced []*PerTokenError
+	for attempt := 1; ; attempt++ {
+		resp, err = c.send(ctx, &m, attempt, correlationID)
+
+		if err == nil {
+			switch resp.statusCode {
+			case http.StatusBadRequest:
+				return nil, ErrBadRequest
+			case http.StatusUnauthorized:
+				return nil, ErrUnauthorized
+			case http.StatusOK:
+				toRetryRegIds, tokenErrs, perr := c.processResp(ctx, registrationIds, resp)
+				if perr != nil {
+					return nil, perr
+				}
+				surfaced = append(surfaced, tokenErrs...)
+				if toRetryRegIds == nil {
+					if len(surfaced) > 0 {
+						return resp.httpResp, &MultiError{Errors: surfaced}
+					}
+					return resp.httpResp, nil
+				}
+				registrationIds = toRetryRegIds
+				m.RegistrationIds = toRetryRegIds
+			}
 		}
 
-		// TODO also process 500's
-		switch resp.statusCode {
-		case http.StatusBadRequest:
-			return nil, fmt.Errorf("Bad Request, invalid json")
-		case http.StatusUnauthorized:
-			return nil, fmt.Errorf("Unauthorized")
-		case http.StatusOK:
-			toRetryRegIds, err := c.processResp(ctx, registrationIds, resp)
+		retry, backoff := policy.ShouldRetry(attempt, resp, err)
+		if !retry || attempt >= c.options.MaxRetryAttempts+1 {
 			if err != nil {
-				return nil, err
-			}
-			if toRetryRegIds != nil {
-				m.RegistrationIds = toRetryRegIds
-
-				backoff := c.calcBackoff(resp.retryAfter, currentBackoff)
-				if resp.retryAfter == nil {
-					currentBackoff = backoff
-				}
-
-				logger.Noticef("RegistrationIds: %v (attempt %d of %d)", toRetryRegIds,
-					attempts, c.options.MaxRetryAttempts)
-				attempts += 1
-				// TODO send in context with cancelation
-				sleepHook(backoff)
-				continue
-			} else {
-				break Loop
+				return nil, Error.Wrap(fmt.Errorf("error sending request to FCM"+
+					" HTTP server: %v", err))
 			}
+			return nil, fmt.Errorf("%w after %d attempts", ErrRetriesExhausted, attempt)
 		}
-		if attempts >= c.options.MaxRetryAttempts+1 {
-			return nil, fmt.Errorf("Exhausted retry attempts")
+
+		if c.options.OnRetry != nil {
+			c.options.OnRetry(ctx, attempt, backoff, err)
 		}
-	}
-	if resp == nil {
-		return nil, fmt.Errorf("No response")
-	}
-	return resp.httpResp, nil
-}
 
-// uses retryAfter if available, otherwise backs off to max backoff
-func (c *Client) calcBackoff(retryAfter *time.Duration,
-	currentBackoff time.Duration) (backoff time.Duration) {
-	if retryAfter != nil {
-		if *retryAfter < c.options.MinBackoff {
-			return c.options.MinBackoff
+		select {
+		case <-ctx.Done():
+			return nil, Error.Wrap(ctx.Err())
+		case <-time.After(backoff):
 		}
-		return *retryAfter
-	}
-	// TODO somehow use the first backoff value
-	backoff = currentBackoff * 2
-	if backoff > c.options.MaxBackoff {
-		return c.options.MaxBackoff
-	} else if backoff < c.options.MinBackoff {
-		return c.options.MinBackoff
 	}
-	return backoff
 }
 
 func (c *Client) processResp(ctx context.Context, registrationIds []string,
-	resp *response) (toRetry []string,
-	err error) {
+	resp *response) (toRetry []string, surfaced []*PerTokenError, err error) {
 	httpResp := resp.httpResp
 	// All successful
 	if httpResp.Failure == 0 && httpResp.CanonicalIds == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	failureReasons := ""
-
 	for i, result := range httpResp.Results {
 		regId := registrationIds[i]
 		// Check for canonical ID
 		if result.MessageId != "" {
 			if result.RegistrationId != "" {
-				logger.Debugf("update: %s to %s", regId, result.RegistrationId)
-				err = c.store.Update(ctx, regId, result.RegistrationId)
-				if err != nil {
-					return nil, err
+				if err := c.store.Update(ctx, regId, result.RegistrationId); err != nil {
+					return nil, nil, err
 				}
 			}
 			continue
 		}
 
-		if isRetry(result.Error) {
+		switch classifyError(result.Error) {
+		case classRetry:
 			toRetry = append(toRetry, regId)
-		} else {
-			logger.Noticef("RegistrationId: %s error: %s", regId, result.Error)
-			failureReasons += fmt.Sprintf("%d: %s\n", i, result.Error)
-			// Probably an unrecoverable error or NotRegistered
-			logger.Debugf("Deleting: %v", regId)
-			err = c.store.Delete(ctx, regId)
-			if err != nil {
-				return nil, err
+		case classDelete:
+			if err := c.store.Delete(ctx, regId); err != nil {
+				return nil, nil, err
 			}
+		case classSurface:
+			surfaced = append(surfaced, &PerTokenError{
+				RegID: regId,
+				Code:  result.Error,
+			})
 		}
 	}
 
-	fmt.Println(httpResp)
-
-	return toRetry, nil
+	return toRetry, surfaced, nil
 }
 
-func (c *Client) send(message *HttpMessage) (*response, error) {
-	logger.Debugf("message: %v", message)
-
+func (c *Client) send(ctx context.Context, message *HttpMessage, attempt int,
+	correlationID string) (*response, error) {
 	data, err := json.Marshal(message)
 	if err != nil {
 		return nil, Error.Wrap(err)
 	}
-	logger.Debugf("send json %s", data)
 
 	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
 	if err != nil {
 		return nil, Error.Wrap(err)
 	}
+	req = req.WithContext(ctx)
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", fmt.Sprintf("key=%s", c.apiKey))
-	logger.Debugf("request: %v", req)
 
+	if c.options.OnRequest != nil {
+		c.options.OnRequest(ctx, RequestLog{
+			Method:        req.Method,
+			URL:           req.URL.String(),
+			Headers:       redactHeaders(req.Header),
+			Body:          data,
+			Attempt:       attempt,
+			CorrelationID: correlationID,
+		})
+	}
+
+	start := nowHook()
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -244,7 +244,6 @@ func (c *Client) send(message *HttpMessage) (*response, error) {
 	if err != nil {
 		return nil, err
 	}
-	logger.Debugf("response: %v", string(body))
 	err = json.Unmarshal(body, &httpResp)
 	if err != nil {
 		return nil, err
@@ -255,6 +254,18 @@ func (c *Client) send(message *HttpMessage) (*response, error) {
 		return nil, err
 	}
 
+	if c.options.OnResponse != nil {
+		c.options.OnResponse(ctx, ResponseLog{
+			StatusCode:    resp.StatusCode,
+			Headers:       resp.Header,
+			Body:          body,
+			HttpResp:      httpResp,
+			Elapsed:       nowHook().Sub(start),
+			Attempt:       attempt,
+			CorrelationID: correlationID,
+		})
+	}
+
 	return &response{
 		httpResp:   httpResp,
 		statusCode: resp.StatusCode,
@@ -262,10 +273,6 @@ func (c *Client) send(message *HttpMessage) (*response, error) {
 	}, nil
 }
 
-func isRetry(err string) bool {
-	return err == "Unavailable" || err == "InternalServerError"
-}
-
 // Two formats:
 // Retry-After: Fri, 31 Dec 1999 23:59:59 GMT
 // Retry-After: 120
@@ -2,6 +2,9 @@ package fcm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"sort"
@@ -28,17 +31,27 @@ func TestSendRetry(t *testing.T) {
 			"b",
 		},
 	}
-	totalSleep := 0 * time.Second
-
-	orgSleepHook := sleepHook
-	defer func() {
-		sleepHook = orgSleepHook
-	}()
-
-	// Total up how long it slept to determine if backoff works
-	sleepHook = func(dur time.Duration) {
-		totalSleep += dur
-	}
+	totalBackoff := 0 * time.Second
+	currentBackoff := test.fcmClient.options.MinBackoff
+
+	// Inject a deterministic RetryPolicy so the test doesn't depend on the
+	// full-jitter randomness of ExponentialJitterPolicy, and returns a zero
+	// backoff so the test doesn't actually wait.
+	test.fcmClient.options.RetryPolicy = RetryPolicyFunc(
+		func(attempt int, resp *response, err error) (bool, time.Duration) {
+			var backoff time.Duration
+			if resp != nil && resp.retryAfter != nil {
+				backoff = *resp.retryAfter
+			} else {
+				backoff = currentBackoff * 2
+				if backoff > test.fcmClient.options.MaxBackoff {
+					backoff = test.fcmClient.options.MaxBackoff
+				}
+				currentBackoff = backoff
+			}
+			totalBackoff += backoff
+			return true, 0
+		})
 
 	unavailableMsg := `{ "multicast_id": 108,
 		"success": 0,
@@ -85,7 +98,75 @@ func TestSendRetry(t *testing.T) {
 	test.AssertEqual(1, len(httpResp.Results))
 	test.AssertEqual("12", httpResp.Results[0].MessageId)
 
-	test.AssertEqual(26*time.Second, totalSleep)
+	test.AssertEqual(26*time.Second, totalBackoff)
+}
+
+func TestSendContextCancelled(t *testing.T) {
+	test := NewTestFcmClient(t)
+	httpMsg := HttpMessage{
+		RegistrationIds: []string{"a"},
+	}
+
+	unavailableMsg := `{ "multicast_id": 108,
+		"success": 0,
+		"failure": 1,
+		"canonical_ids": 0,
+		"results": [
+			{ "error": "Unavailable" }
+		]
+	}`
+	test.AddResponse(NewResponse(200, unavailableMsg))
+	test.AddResponse(NewResponse(200, unavailableMsg))
+
+	// A policy that always wants to retry after an hour - cancellation
+	// should win the select long before that backoff would ever fire.
+	test.fcmClient.options.RetryPolicy = RetryPolicyFunc(
+		func(attempt int, resp *response, err error) (bool, time.Duration) {
+			return true, time.Hour
+		})
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, err := test.fcmClient.Send(cancelledCtx, httpMsg)
+	test.Assert(err != nil)
+	test.Assert(strings.Contains(err.Error(), context.Canceled.Error()))
+}
+
+func TestRequestResponseHooks(t *testing.T) {
+	test := NewTestFcmClient(t)
+	httpMsg := HttpMessage{
+		RegistrationIds: []string{"a"},
+	}
+
+	successMsg := `{ "multicast_id": 108,
+		"success": 1,
+		"failure": 0,
+		"canonical_ids": 0,
+		"results": [
+			{ "message_id": "12" }
+		]
+	}`
+	test.AddResponse(NewResponse(200, successMsg))
+
+	var gotReq RequestLog
+	var gotResp ResponseLog
+	test.fcmClient.options.OnRequest = func(ctx context.Context, req RequestLog) {
+		gotReq = req
+	}
+	test.fcmClient.options.OnResponse = func(ctx context.Context, resp ResponseLog) {
+		gotResp = resp
+	}
+
+	_, err := test.fcmClient.Send(ctx, httpMsg)
+	test.AssertNoError(err)
+
+	test.AssertEqual("REDACTED", gotReq.Headers.Get("Authorization"))
+	test.AssertEqual(1, gotReq.Attempt)
+	test.Assert(gotReq.CorrelationID != "")
+	test.AssertEqual(gotReq.CorrelationID, gotResp.CorrelationID)
+	test.AssertEqual(200, gotResp.StatusCode)
+	test.AssertEqual(uint(1), gotResp.HttpResp.Success)
 }
 
 func TestProcessRespSuccess(t *testing.T) {
@@ -108,9 +189,10 @@ func TestProcessRespSuccess(t *testing.T) {
 		"a",
 	}
 
-	toRetry, err := test.fcmClient.processResp(ctx, regIds, resp)
+	toRetry, surfaced, err := test.fcmClient.processResp(ctx, regIds, resp)
 	test.AssertNoError(err)
 	test.AssertEqual(len(toRetry), 0)
+	test.AssertEqual(len(surfaced), 0)
 }
 
 func TestProcessRespMultipleResults(t *testing.T) {
@@ -155,8 +237,9 @@ func TestProcessRespMultipleResults(t *testing.T) {
 	}
 	test.AddRegIds(regIds)
 
-	toRetry, err := test.fcmClient.processResp(ctx, regIds, resp)
+	toRetry, surfaced, err := test.fcmClient.processResp(ctx, regIds, resp)
 	test.AssertNoError(err)
+	test.AssertEqual(len(surfaced), 0)
 
 	expectedRetry := []string{
 		"8",
@@ -173,6 +256,146 @@ func TestProcessRespMultipleResults(t *testing.T) {
 
 }
 
+func TestProcessRespSurfacesUnclassifiedErrors(t *testing.T) {
+	test := NewTestFcmClient(t)
+
+	resp := &response{
+		httpResp: &HttpResponse{
+			Success: 1,
+			Failure: 1,
+			Results: []Result{
+				{MessageId: "1:08"},
+				{Error: "MessageRateExceeded"},
+			},
+		},
+	}
+	regIds := []string{"a", "b"}
+	test.AddRegIds(regIds)
+
+	toRetry, surfaced, err := test.fcmClient.processResp(ctx, regIds, resp)
+	test.AssertNoError(err)
+	test.AssertEqual(len(toRetry), 0)
+	test.AssertEqual(len(surfaced), 1)
+	test.AssertEqual("b", surfaced[0].RegID)
+	test.AssertEqual("MessageRateExceeded", surfaced[0].Code)
+
+	// "b" is neither retry-worthy nor delete-worthy, so it must survive in
+	// the Store for the caller to decide what to do with it.
+	test.AssertEqual([]string{"a", "b"}, test.GetRegIds())
+
+	multi := &MultiError{Errors: surfaced}
+	test.Assert(errors.Is(multi, ErrQuotaExceeded))
+}
+
+func TestTopicManagerSubscribeBatch(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+
+	tokens := []string{"a", "b"}
+	test.AddRegIds(tokens)
+
+	batchResp := `{ "results": [ {}, { "error": "NOT_FOUND" } ] }`
+	test.AddResponse(NewResponse(200, batchResp))
+
+	err := tm.Subscribe(ctx, "news", tokens)
+	test.AssertNoError(err)
+	test.AssertEqual([]string{"a"}, test.GetRegIds())
+}
+
+func TestTopicManagerSubscribeSingle(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+
+	test.AddResponse(NewResponse(200, `{}`))
+
+	err := tm.Subscribe(ctx, "news", []string{"a"})
+	test.AssertNoError(err)
+}
+
+func TestTopicManagerSubscribeSingleNotFound(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+	test.AddRegIds([]string{"a"})
+
+	test.AddResponse(NewResponse(404, `{ "error": "NOT_FOUND" }`))
+
+	err := tm.Subscribe(ctx, "news", []string{"a"})
+	test.AssertNoError(err)
+	test.AssertEqual([]string(nil), test.GetRegIds())
+}
+
+func TestTopicManagerSubscribeSingleSurfacesUnclassifiedError(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+	test.AddRegIds([]string{"a"})
+
+	test.AddResponse(NewResponse(400, `{ "error": "INVALID_TOPIC_NAME" }`))
+
+	err := tm.Subscribe(ctx, "news", []string{"a"})
+	test.Assert(err != nil)
+
+	multi, ok := err.(*MultiError)
+	test.Assert(ok)
+	test.AssertEqual(1, len(multi.Errors))
+	test.AssertEqual("a", multi.Errors[0].RegID)
+
+	// An error the Instance ID service doesn't tell us is a bad token must
+	// not delete a token that might still be valid.
+	test.AssertEqual([]string{"a"}, test.GetRegIds())
+}
+
+func TestTopicManagerSubscribeChunksOverBatchLimit(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+
+	tokens := make([]string, iidBatchLimit+1)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+	}
+	test.AddRegIds(tokens)
+
+	batchResp, err := json.Marshal(batchResponse{Results: make([]batchResult, iidBatchLimit)})
+	test.AssertNoError(err)
+	test.AddResponse(NewResponse(200, string(batchResp)))
+	// The remaining token goes through the single-token endpoint.
+	test.AddResponse(NewResponse(200, `{}`))
+
+	err = tm.Subscribe(ctx, "news", tokens)
+	test.AssertNoError(err)
+	test.AssertEqual(2, test.RespCount)
+}
+
+func TestTopicManagerTokenInfo(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+
+	infoResp := `{
+		"application": "com.example.app",
+		"authorizedEntity": "123456789",
+		"platform": "ANDROID",
+		"rel": { "topics": { "news": {} } }
+	}`
+	test.AddResponse(NewResponse(200, infoResp))
+
+	info, err := tm.TokenInfo(ctx, "a")
+	test.AssertNoError(err)
+	test.AssertEqual("com.example.app", info.Application)
+	test.AssertEqual("123456789", info.AuthorizedEntity)
+	test.AssertEqual("ANDROID", info.Platform)
+	_, subscribed := info.Rel.Topics["news"]
+	test.Assert(subscribed)
+}
+
+func TestTopicManagerTokenInfoError(t *testing.T) {
+	test := NewTestFcmClient(t)
+	tm := NewTopicManager("api_key", test, test, nil)
+
+	test.AddResponse(NewResponse(404, `{ "error": "NOT_FOUND" }`))
+
+	_, err := tm.TokenInfo(ctx, "a")
+	test.Assert(err != nil)
+}
+
 func TestParseRetryAfter(t *testing.T) {
 	test := NewTestFcmClient(t)
 
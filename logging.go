@@ -0,0 +1,57 @@
+package fcm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RequestLog describes a single outbound request made by Client.Send, for
+// consumption by an OnRequest hook.
+type RequestLog struct {
+	Method  string
+	URL     string
+	Headers http.Header // Authorization is redacted
+	Body    []byte
+
+	// Attempt is 1 on the first try, incrementing on each retry.
+	Attempt int
+	// CorrelationID is stable across every attempt of a single Send call.
+	CorrelationID string
+}
+
+// ResponseLog describes the response to a single outbound request, for
+// consumption by an OnResponse hook.
+type ResponseLog struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+	HttpResp   *HttpResponse
+	Elapsed    time.Duration
+
+	Attempt       int
+	CorrelationID string
+}
+
+// redactHeaders returns a copy of h with the Authorization header replaced,
+// suitable for passing to an OnRequest hook.
+func redactHeaders(h http.Header) http.Header {
+	redacted := h.Clone()
+	if redacted.Get("Authorization") != "" {
+		redacted.Set("Authorization", "REDACTED")
+	}
+	return redacted
+}
+
+// newCorrelationID returns a random identifier used to tie together the
+// RequestLog/ResponseLog values passed to hooks over the lifetime of one
+// Client.Send call. OnRetry is not given the identifier.
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", nowHook().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,198 @@
+package fcm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	firebaseMessagingScope = "https://www.googleapis.com/auth/firebase.messaging"
+	googleTokenURL         = "https://oauth2.googleapis.com/token"
+	grantType              = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	// refresh this long before the access token actually expires
+	tokenExpiryLeeway = 60 * time.Second
+)
+
+// ServiceAccount is the subset of a Google service-account JSON credential
+// file needed to mint OAuth2 access tokens.
+type ServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectId    string `json:"project_id"`
+	PrivateKeyId string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// ParseServiceAccount parses a service-account JSON credential file as
+// downloaded from the Google Cloud console.
+func ParseServiceAccount(data []byte) (*ServiceAccount, error) {
+	account := &ServiceAccount{}
+	if err := json.Unmarshal(data, account); err != nil {
+		return nil, Error.Wrap(err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, Error.New("service account missing client_email or private_key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = googleTokenURL
+	}
+	return account, nil
+}
+
+// tokenSource mints and caches OAuth2 access tokens for a service account,
+// refreshing them shortly before they expire. It is safe for concurrent use.
+type tokenSource struct {
+	account *ServiceAccount
+	client  HttpClient
+	key     *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func newTokenSource(account *ServiceAccount, client HttpClient) (*tokenSource, error) {
+	key, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenSource{
+		account: account,
+		client:  client,
+		key:     key,
+	}, nil
+}
+
+// Token returns a valid access token, minting and caching a new one if the
+// cached token is missing or about to expire.
+func (ts *tokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.accessToken != "" && nowHook().Before(ts.expiresAt.Add(-tokenExpiryLeeway)) {
+		return ts.accessToken, nil
+	}
+
+	token, expiresIn, err := ts.mint(ctx)
+	if err != nil {
+		return "", err
+	}
+	ts.accessToken = token
+	ts.expiresAt = nowHook().Add(time.Duration(expiresIn) * time.Second)
+	return ts.accessToken, nil
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+func (ts *tokenSource) mint(ctx context.Context) (token string, expiresIn int, err error) {
+	assertion, err := ts.signAssertion()
+	if err != nil {
+		return "", 0, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", grantType)
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequest("POST", ts.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, Error.Wrap(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", 0, Error.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, Error.Wrap(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, Error.New("token exchange failed: %d: %s", resp.StatusCode, body)
+	}
+
+	tr := &tokenResponse{}
+	if err := json.Unmarshal(body, tr); err != nil {
+		return "", 0, Error.Wrap(err)
+	}
+	return tr.AccessToken, tr.ExpiresIn, nil
+}
+
+func (ts *tokenSource) signAssertion() (string, error) {
+	now := nowHook()
+	claims := map[string]interface{}{
+		"iss":   ts.account.ClientEmail,
+		"scope": firebaseMessagingScope,
+		"aud":   ts.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", Error.Wrap(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", Error.Wrap(err)
+	}
+
+	signingInput := base64URLEncode(header) + "." + base64URLEncode(payload)
+
+	hashed := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ts.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", Error.Wrap(err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func base64URLEncode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parsePrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, Error.New("failed to decode PEM private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, Error.Wrap(fmt.Errorf("parsing private key: %v", err))
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, Error.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,105 @@
+package fcm
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides, after an attempt completes, whether Client.Send
+// should retry and how long to wait before doing so.
+type RetryPolicy interface {
+	// ShouldRetry inspects the outcome of an attempt - its raw response (nil
+	// on transport failure) and any transport error - and reports whether to
+	// retry and, if so, the backoff to wait first.
+	ShouldRetry(attempt int, resp *response, err error) (retry bool, backoff time.Duration)
+}
+
+// RetryPolicyFunc adapts a plain function to a RetryPolicy.
+type RetryPolicyFunc func(attempt int, resp *response, err error) (bool, time.Duration)
+
+func (f RetryPolicyFunc) ShouldRetry(attempt int, resp *response, err error) (bool, time.Duration) {
+	return f(attempt, resp, err)
+}
+
+// ExponentialJitterPolicy is the default RetryPolicy. It retries transport
+// errors, HTTP 500/502/503/504 responses, and 200 responses that left some
+// registration IDs to retry, using "full jitter" exponential backoff
+// (https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/)
+// with MinBackoff as the base and MaxBackoff as the cap; the computed backoff
+// is drawn from [0, cap) and so can be shorter than MinBackoff. A Retry-After
+// header on the response, if present, is honored verbatim instead of the
+// computed backoff.
+type ExponentialJitterPolicy struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+func NewExponentialJitterPolicy(minBackoff, maxBackoff time.Duration) *ExponentialJitterPolicy {
+	return &ExponentialJitterPolicy{MinBackoff: minBackoff, MaxBackoff: maxBackoff}
+}
+
+func (p *ExponentialJitterPolicy) ShouldRetry(attempt int, resp *response,
+	err error) (bool, time.Duration) {
+	if !p.retryable(resp, err) {
+		return false, 0
+	}
+
+	if resp != nil && resp.retryAfter != nil {
+		return true, *resp.retryAfter
+	}
+
+	return true, p.fullJitter(attempt)
+}
+
+func (p *ExponentialJitterPolicy) retryable(resp *response, err error) bool {
+	if err != nil {
+		return true
+	}
+	if resp == nil {
+		return false
+	}
+	switch resp.statusCode {
+	case http.StatusOK, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// fullJitter computes rand(0, min(cap, base*2^attempt)).
+func (p *ExponentialJitterPolicy) fullJitter(attempt int) time.Duration {
+	base := p.MinBackoff
+	if base <= 0 {
+		base = defaultMinBackoff
+	}
+	capBackoff := p.MaxBackoff
+	if capBackoff <= 0 {
+		capBackoff = defaultMaxBackoff
+	}
+
+	max := base
+	for i := 0; i < attempt && max < capBackoff; i++ {
+		max *= 2
+	}
+	if max > capBackoff {
+		max = capBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// doubleBackoff doubles currentBackoff, bounded by [min, max]. V1Client and
+// TopicManager predate the RetryPolicy abstraction above and retry their own
+// single-purpose loops rather than accepting a pluggable policy, so they
+// share this instead of each keeping its own copy of the same doubling math.
+func doubleBackoff(currentBackoff, min, max time.Duration) time.Duration {
+	backoff := currentBackoff * 2
+	if backoff > max {
+		return max
+	} else if backoff < min {
+		return min
+	}
+	return backoff
+}
@@ -0,0 +1,300 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	iidSingleEndpoint      = "https://iid.googleapis.com/iid/v1/%s/rel/topics/%s"
+	iidBatchAddEndpoint    = "https://iid.googleapis.com/iid/v1:batchAdd"
+	iidBatchRemoveEndpoint = "https://iid.googleapis.com/iid/v1:batchRemove"
+	iidInfoEndpoint        = "https://iid.googleapis.com/iid/info/%s?details=true"
+
+	// iidBatchLimit is the maximum number of tokens Google's Instance ID
+	// service accepts per batchAdd/batchRemove call.
+	iidBatchLimit = 1000
+)
+
+// TopicManager manages FCM topic subscriptions through Google's Instance ID
+// service, reusing the same HttpClient, API key auth, and Store as Client.
+type TopicManager struct {
+	apiKey  string
+	client  HttpClient
+	store   Store
+	options *ClientOptions
+}
+
+// NewTopicManager builds a TopicManager. When options == nil, default
+// values are used.
+func NewTopicManager(apiKey string, client HttpClient, store Store,
+	options *ClientOptions) *TopicManager {
+	if options == nil {
+		options = DefaultClientOptions()
+	}
+	return &TopicManager{
+		apiKey:  apiKey,
+		client:  client,
+		store:   store,
+		options: options,
+	}
+}
+
+// TokenInfo is the Instance ID service's view of a single token, including
+// the topics it's currently subscribed to.
+type TokenInfo struct {
+	Application      string `json:"application,omitempty"`
+	AuthorizedEntity string `json:"authorizedEntity,omitempty"`
+	Platform         string `json:"platform,omitempty"`
+	Rel              struct {
+		Topics map[string]struct{} `json:"topics,omitempty"`
+	} `json:"rel,omitempty"`
+}
+
+type batchRequest struct {
+	To                 string   `json:"to"`
+	RegistrationTokens []string `json:"registration_tokens"`
+}
+
+type batchResult struct {
+	Error string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results,omitempty"`
+}
+
+// Subscribe subscribes tokens to topic, in batches of up to 1000. Tokens
+// the Instance ID service reports as invalid or unregistered are routed
+// through Store.Delete; any other per-token failure is returned as a
+// MultiError.
+func (tm *TopicManager) Subscribe(ctx context.Context, topic string, tokens []string) error {
+	return tm.modify(ctx, http.MethodPost, iidBatchAddEndpoint, topic, tokens)
+}
+
+// Unsubscribe removes tokens from topic, in batches of up to 1000, with the
+// same error handling as Subscribe.
+func (tm *TopicManager) Unsubscribe(ctx context.Context, topic string, tokens []string) error {
+	return tm.modify(ctx, http.MethodDelete, iidBatchRemoveEndpoint, topic, tokens)
+}
+
+// TokenInfo fetches what the Instance ID service knows about token,
+// including its current topic subscriptions.
+func (tm *TopicManager) TokenInfo(ctx context.Context, token string) (*TokenInfo, error) {
+	url := fmt.Sprintf(iidInfoEndpoint, token)
+	body, statusCode, err := tm.sendWithRetry(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, Error.New("instance id info request failed: %d: %s", statusCode, body)
+	}
+
+	info := &TokenInfo{}
+	if err := json.Unmarshal(body, info); err != nil {
+		return nil, Error.Wrap(err)
+	}
+	return info, nil
+}
+
+func (tm *TopicManager) modify(ctx context.Context, singleMethod, batchEndpoint,
+	topic string, tokens []string) error {
+	var surfaced []*PerTokenError
+
+	for start := 0; start < len(tokens); start += iidBatchLimit {
+		end := start + iidBatchLimit
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		chunk := tokens[start:end]
+
+		// The Instance ID service exposes a dedicated endpoint for a single
+		// token; only fall back to the batch endpoint for more than one.
+		if len(chunk) == 1 {
+			tokenErr, err := tm.modifySingle(ctx, singleMethod, topic, chunk[0])
+			if err != nil {
+				return err
+			}
+			if tokenErr != nil {
+				surfaced = append(surfaced, tokenErr)
+			}
+			continue
+		}
+
+		chunkErrs, err := tm.modifyBatch(ctx, batchEndpoint, topic, chunk)
+		if err != nil {
+			return err
+		}
+		surfaced = append(surfaced, chunkErrs...)
+	}
+
+	if len(surfaced) > 0 {
+		return &MultiError{Errors: surfaced}
+	}
+	return nil
+}
+
+// modifySingle calls the single-token IID endpoint and classifies the
+// result the same way modifyBatch classifies a batchAdd/batchRemove entry:
+// a token reported invalid or not found is routed to Store.Delete, any other
+// error is returned as a PerTokenError for the caller to inspect.
+func (tm *TopicManager) modifySingle(ctx context.Context, method, topic,
+	token string) (*PerTokenError, error) {
+	url := fmt.Sprintf(iidSingleEndpoint, token, topic)
+	body, statusCode, err := tm.sendWithRetry(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == http.StatusOK {
+		return nil, nil
+	}
+
+	result := &batchResult{}
+	if jsonErr := json.Unmarshal(body, result); jsonErr != nil || result.Error == "" {
+		return nil, Error.New("instance id request failed: %d: %s", statusCode, body)
+	}
+
+	if classifyIIDError(result.Error) == classDelete {
+		if err := tm.store.Delete(ctx, token); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &PerTokenError{RegID: token, Code: result.Error}, nil
+}
+
+func (tm *TopicManager) modifyBatch(ctx context.Context, endpoint, topic string,
+	tokens []string) ([]*PerTokenError, error) {
+	reqBody, err := json.Marshal(batchRequest{
+		To:                 "/topics/" + topic,
+		RegistrationTokens: tokens,
+	})
+	if err != nil {
+		return nil, Error.Wrap(err)
+	}
+
+	body, statusCode, err := tm.sendWithRetry(ctx, http.MethodPost, endpoint, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, Error.New("instance id batch request failed: %d: %s", statusCode, body)
+	}
+
+	batchResp := &batchResponse{}
+	if err := json.Unmarshal(body, batchResp); err != nil {
+		return nil, Error.Wrap(err)
+	}
+	if len(batchResp.Results) > len(tokens) {
+		return nil, Error.New("instance id batch response had %d results for %d tokens",
+			len(batchResp.Results), len(tokens))
+	}
+
+	var surfaced []*PerTokenError
+	for i, result := range batchResp.Results {
+		if result.Error == "" {
+			continue
+		}
+		token := tokens[i]
+		if classifyIIDError(result.Error) == classDelete {
+			if err := tm.store.Delete(ctx, token); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		surfaced = append(surfaced, &PerTokenError{RegID: token, Code: result.Error})
+	}
+	return surfaced, nil
+}
+
+// classifyIIDError reports how modifyBatch should react to a per-token
+// error code from a batchAdd/batchRemove response.
+func classifyIIDError(code string) tokenErrorClass {
+	switch code {
+	case "NOT_FOUND", "INVALID_ARGUMENT":
+		return classDelete
+	default:
+		return classSurface
+	}
+}
+
+// sendWithRetry performs a single Instance ID API call, retrying on
+// transport errors and 500/502/503/504 responses with a backoff that doubles
+// between MinBackoff and MaxBackoff, honoring ctx cancellation while backing
+// off between attempts. options.RetryPolicy and the logging hooks are not
+// used here.
+func (tm *TopicManager) sendWithRetry(ctx context.Context, method, url string,
+	body []byte) (respBody []byte, statusCode int, err error) {
+	currentBackoff := tm.options.MinBackoff
+
+	for attempt := 1; ; attempt++ {
+		respBody, statusCode, err = tm.do(ctx, method, url, body)
+
+		retry := err != nil || retryableStatus(statusCode)
+		if !retry {
+			return respBody, statusCode, err
+		}
+		if attempt >= tm.options.MaxRetryAttempts+1 {
+			if err != nil {
+				return nil, 0, Error.Wrap(fmt.Errorf("error calling instance ID"+
+					" service: %v", err))
+			}
+			return nil, 0, fmt.Errorf("%w after %d attempts", ErrRetriesExhausted, attempt)
+		}
+
+		backoff := doubleBackoff(currentBackoff, tm.options.MinBackoff, tm.options.MaxBackoff)
+		currentBackoff = backoff
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, Error.Wrap(ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (tm *TopicManager) do(ctx context.Context, method, url string,
+	body []byte) ([]byte, int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, 0, Error.Wrap(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", fmt.Sprintf("key=%s", tm.apiKey))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := tm.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return respBody, resp.StatusCode, nil
+}
+
+func retryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,173 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const v1Endpoint = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+
+// V1Client sends messages through the FCM HTTP v1 API, authenticating each
+// request with an OAuth2 access token minted from a service-account
+// credential. Unlike Client, the v1 API accepts only a single target
+// (Token, Topic or Condition) per request; use SendMulti to fan a message
+// out to many registration tokens.
+type V1Client struct {
+	projectId string
+	tokens    *tokenSource
+	client    HttpClient
+	store     Store
+	options   *ClientOptions
+}
+
+// NewV1Client builds a V1Client from a Google service-account JSON
+// credential. When options == nil, default values are used.
+func NewV1Client(credentials []byte, client HttpClient, store Store,
+	options *ClientOptions) (*V1Client, error) {
+	account, err := ParseServiceAccount(credentials)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := newTokenSource(account, client)
+	if err != nil {
+		return nil, err
+	}
+
+	if options == nil {
+		options = DefaultClientOptions()
+	}
+
+	return &V1Client{
+		projectId: account.ProjectId,
+		tokens:    tokens,
+		client:    client,
+		store:     store,
+		options:   options,
+	}, nil
+}
+
+// Send delivers m to its Token, Topic or Condition, retrying with
+// exponential backoff on transient failures.
+func (c *V1Client) Send(ctx context.Context, m Message) (*v1Response, error) {
+	currentBackoff := c.options.MinBackoff
+
+	for attempts := 1; ; attempts++ {
+		v1Resp, retry, err := c.send(ctx, &m)
+		if err == nil {
+			return v1Resp, nil
+		}
+		if !retry {
+			return nil, err
+		}
+		if attempts >= c.options.MaxRetryAttempts+1 {
+			return nil, fmt.Errorf("%w after %d attempts: %v", ErrRetriesExhausted, attempts, err)
+		}
+
+		backoff := doubleBackoff(currentBackoff, c.options.MinBackoff, c.options.MaxBackoff)
+		currentBackoff = backoff
+
+		select {
+		case <-ctx.Done():
+			return nil, Error.Wrap(ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// SendMulti sends m to each of tokens, setting m.Token per-request since the
+// v1 API only accepts a single target. It returns the first error
+// encountered for any token, if any, after attempting delivery to all of
+// them.
+func (c *V1Client) SendMulti(ctx context.Context, tokens []string, m Message) error {
+	var firstErr error
+	for _, token := range tokens {
+		msg := m
+		msg.Token = token
+		if _, err := c.Send(ctx, msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// send makes a single attempt and reports whether the error, if any, is
+// worth retrying.
+func (c *V1Client) send(ctx context.Context, m *Message) (resp *v1Response,
+	retry bool, err error) {
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := json.Marshal(map[string]*Message{"message": m})
+	if err != nil {
+		return nil, false, Error.Wrap(err)
+	}
+
+	url := fmt.Sprintf(v1Endpoint, c.projectId)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, false, Error.Wrap(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	httpResp, err := c.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer httpResp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, false, Error.Wrap(err)
+	}
+
+	if httpResp.StatusCode == http.StatusOK {
+		v1Resp := &v1Response{}
+		if err := json.Unmarshal(body, v1Resp); err != nil {
+			return nil, false, Error.Wrap(err)
+		}
+		return v1Resp, false, nil
+	}
+
+	retry, err = c.processError(ctx, m, httpResp.StatusCode, body)
+	return nil, retry, err
+}
+
+// processError translates a v1 error response into the same Store.Delete
+// call that Client.processResp makes for a delete-worthy legacy token
+// (Store.Update is never called here), and reports whether the request
+// should be retried.
+func (c *V1Client) processError(ctx context.Context, m *Message, statusCode int,
+	body []byte) (retry bool, err error) {
+	errResp := &v1ErrorResponse{}
+	if jsonErr := json.Unmarshal(body, errResp); jsonErr != nil {
+		return false, Error.New("fcm v1 error %d: %s", statusCode, body)
+	}
+
+	code := errResp.errorCode()
+	switch code {
+	case "UNREGISTERED":
+		if m.Token != "" {
+			if err := c.store.Delete(ctx, m.Token); err != nil {
+				return false, err
+			}
+		}
+		return false, &PerTokenError{RegID: m.Token, Code: code}
+	case "INVALID_ARGUMENT":
+		return false, &PerTokenError{RegID: m.Token, Code: code}
+	case "QUOTA_EXCEEDED":
+		return true, fmt.Errorf("%w: %s", ErrQuotaExceeded, errResp.Error.Message)
+	case "UNAVAILABLE", "INTERNAL":
+		return true, Error.New("%s: %s", code, errResp.Error.Message)
+	default:
+		return false, Error.New("fcm v1 error %d: %s", statusCode, errResp.Error.Message)
+	}
+}
@@ -0,0 +1,82 @@
+package fcm
+
+// Message is a single FCM HTTP v1 API message. Unlike the legacy HttpMessage,
+// the v1 API accepts exactly one of Token, Topic or Condition as the target.
+type Message struct {
+	Token        string               `json:"token,omitempty"`
+	Topic        string               `json:"topic,omitempty"`
+	Condition    string               `json:"condition,omitempty"`
+	Data         Data                 `json:"data,omitempty"`
+	Notification *MessageNotification `json:"notification,omitempty"`
+	Android      *AndroidConfig       `json:"android,omitempty"`
+	APNS         *APNSConfig          `json:"apns,omitempty"`
+	WebPush      *WebpushConfig       `json:"webpush,omitempty"`
+	FCMOptions   *FCMOptions          `json:"fcm_options,omitempty"`
+}
+
+// MessageNotification is the basic, platform-independent notification
+// payload of a v1 Message.
+type MessageNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// AndroidConfig holds Android-specific delivery options for a v1 Message.
+type AndroidConfig struct {
+	CollapseKey  string               `json:"collapse_key,omitempty"`
+	Priority     string               `json:"priority,omitempty"`
+	TTL          string               `json:"ttl,omitempty"`
+	Notification *MessageNotification `json:"notification,omitempty"`
+}
+
+// APNSConfig holds APNS-specific delivery options for a v1 Message. Payload
+// is passed through verbatim as the APNS payload (aps dictionary and any
+// custom keys).
+type APNSConfig struct {
+	Headers map[string]string      `json:"headers,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// WebpushConfig holds Web Push-specific delivery options for a v1 Message.
+type WebpushConfig struct {
+	Headers      map[string]string    `json:"headers,omitempty"`
+	Data         map[string]string    `json:"data,omitempty"`
+	Notification *MessageNotification `json:"notification,omitempty"`
+}
+
+// FCMOptions holds options that are common across platforms for a v1
+// Message.
+type FCMOptions struct {
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// v1Response is the body of a successful v1 messages:send response.
+type v1Response struct {
+	Name string `json:"name,omitempty"`
+}
+
+// v1ErrorResponse is the body of a failed v1 messages:send response, per the
+// standard Google API error format.
+type v1ErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// errorCode returns the FCM-specific error code (e.g. "UNREGISTERED") from
+// the error details, or the empty string if none is present.
+func (e *v1ErrorResponse) errorCode() string {
+	for _, d := range e.Error.Details {
+		if d.ErrorCode != "" {
+			return d.ErrorCode
+		}
+	}
+	return ""
+}
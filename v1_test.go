@@ -0,0 +1,222 @@
+package fcm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amozoss/atest"
+)
+
+func TestParseServiceAccount(t *testing.T) {
+	test := atest.Wrap(t, 2)
+
+	key := generateTestKey(test, false)
+	data := []byte(fmt.Sprintf(`{
+		"type": "service_account",
+		"project_id": "my-project",
+		"private_key": %q,
+		"client_email": "fcm@my-project.iam.gserviceaccount.com"
+	}`, key))
+
+	account, err := ParseServiceAccount(data)
+	test.AssertNoError(err)
+	test.AssertEqual("my-project", account.ProjectId)
+	test.AssertEqual(googleTokenURL, account.TokenURI)
+}
+
+func TestParseServiceAccountMissingFields(t *testing.T) {
+	test := atest.Wrap(t, 2)
+
+	_, err := ParseServiceAccount([]byte(`{"type": "service_account"}`))
+	test.Assert(err != nil)
+}
+
+func TestParsePrivateKeyPKCS1(t *testing.T) {
+	test := atest.Wrap(t, 2)
+
+	pemKey := generateTestKey(test, false)
+	key, err := parsePrivateKey(pemKey)
+	test.AssertNoError(err)
+	test.Assert(key != nil)
+}
+
+func TestParsePrivateKeyPKCS8(t *testing.T) {
+	test := atest.Wrap(t, 2)
+
+	pemKey := generateTestKey(test, true)
+	key, err := parsePrivateKey(pemKey)
+	test.AssertNoError(err)
+	test.Assert(key != nil)
+}
+
+// fakeTokenClient serves a canned token response, counting how many times
+// Do is called so tests can assert on whether the token was re-minted.
+type fakeTokenClient struct {
+	calls       int
+	accessToken string
+	expiresIn   int
+}
+
+func (c *fakeTokenClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls++
+	body, _ := json.Marshal(tokenResponse{
+		AccessToken: fmt.Sprintf("%s-%d", c.accessToken, c.calls),
+		ExpiresIn:   c.expiresIn,
+		TokenType:   "Bearer",
+	})
+	return NewResponse(200, string(body)), nil
+}
+
+func TestTokenSourceCachesUntilLeeway(t *testing.T) {
+	test := atest.Wrap(t, 2)
+
+	orgNowHook := nowHook
+	defer func() { nowHook = orgNowHook }()
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	nowHook = func() time.Time { return now }
+
+	account := &ServiceAccount{
+		ClientEmail: "fcm@my-project.iam.gserviceaccount.com",
+		PrivateKey:  generateTestKey(test, false),
+		TokenURI:    googleTokenURL,
+	}
+	client := &fakeTokenClient{accessToken: "tok", expiresIn: 3600}
+	ts, err := newTokenSource(account, client)
+	test.AssertNoError(err)
+
+	token1, err := ts.Token(context.Background())
+	test.AssertNoError(err)
+	test.AssertEqual("tok-1", token1)
+	test.AssertEqual(1, client.calls)
+
+	// Still well inside the cached token's lifetime: no re-mint.
+	token2, err := ts.Token(context.Background())
+	test.AssertNoError(err)
+	test.AssertEqual(token1, token2)
+	test.AssertEqual(1, client.calls)
+
+	// Advance to expiresAt minus the leeway: must re-mint.
+	now = now.Add(3600*time.Second - tokenExpiryLeeway)
+	token3, err := ts.Token(context.Background())
+	test.AssertNoError(err)
+	test.AssertEqual("tok-2", token3)
+	test.AssertEqual(2, client.calls)
+}
+
+func newTestV1Client(t *testing.T, store Store) (*V1Client, *atest.Test) {
+	test := atest.Wrap(t, 2)
+	account := fmt.Sprintf(`{
+		"type": "service_account",
+		"project_id": "my-project",
+		"private_key": %q,
+		"client_email": "fcm@my-project.iam.gserviceaccount.com"
+	}`, generateTestKey(test, false))
+
+	c, err := NewV1Client([]byte(account), &fakeTokenClient{accessToken: "tok", expiresIn: 3600}, store, nil)
+	test.AssertNoError(err)
+	return c, test
+}
+
+func TestV1ProcessErrorUnregistered(t *testing.T) {
+	c, test := newTestV1Client(t, &fakeStore{})
+	m := &Message{Token: "a"}
+
+	body := v1ErrorBody("UNREGISTERED", "the token is no longer registered")
+	retry, err := c.processError(context.Background(), m, 404, body)
+	test.Assert(!retry)
+
+	var pe *PerTokenError
+	test.Assert(errors.As(err, &pe))
+	test.AssertEqual("a", pe.RegID)
+	test.AssertEqual("UNREGISTERED", pe.Code)
+}
+
+func TestV1ProcessErrorQuotaExceeded(t *testing.T) {
+	c, test := newTestV1Client(t, &fakeStore{})
+	m := &Message{Token: "a"}
+
+	body := v1ErrorBody("QUOTA_EXCEEDED", "exceeded the rate limit")
+	retry, err := c.processError(context.Background(), m, 429, body)
+	test.Assert(retry)
+	test.Assert(strings.Contains(err.Error(), "exceeded the rate limit"))
+	test.Assert(errors.Is(err, ErrQuotaExceeded))
+}
+
+func TestV1ProcessErrorUnavailable(t *testing.T) {
+	c, test := newTestV1Client(t, &fakeStore{})
+	m := &Message{Token: "a"}
+
+	body := v1ErrorBody("UNAVAILABLE", "backend unavailable")
+	retry, err := c.processError(context.Background(), m, 503, body)
+	test.Assert(retry)
+	test.Assert(err != nil)
+}
+
+func TestV1ProcessErrorInvalidArgument(t *testing.T) {
+	c, test := newTestV1Client(t, &fakeStore{})
+	m := &Message{Token: "a"}
+
+	body := v1ErrorBody("INVALID_ARGUMENT", "bad token format")
+	retry, err := c.processError(context.Background(), m, 400, body)
+	test.Assert(!retry)
+
+	var pe *PerTokenError
+	test.Assert(errors.As(err, &pe))
+	test.AssertEqual("INVALID_ARGUMENT", pe.Code)
+}
+
+// v1ErrorBody builds a v1ErrorResponse-shaped body with code as the FCM
+// error detail, matching what the real API returns.
+func v1ErrorBody(code, message string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    400,
+			"message": message,
+			"status":  code,
+			"details": []map[string]string{
+				{"@type": "type.googleapis.com/google.firebase.fcm.v1.FcmError", "errorCode": code},
+			},
+		},
+	})
+	return body
+}
+
+type fakeStore struct {
+	deleted []string
+}
+
+func (s *fakeStore) Update(ctx context.Context, oldRegId, newRegId string) error {
+	return nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, regId string) error {
+	s.deleted = append(s.deleted, regId)
+	return nil
+}
+
+// generateTestKey generates a fresh RSA key and PEM-encodes it, either as
+// PKCS1 ("RSA PRIVATE KEY") or PKCS8 ("PRIVATE KEY"), to exercise both
+// formats parsePrivateKey accepts.
+func generateTestKey(test *atest.Test, pkcs8 bool) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	test.AssertNoError(err)
+
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		test.AssertNoError(err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+
+	der := x509.MarshalPKCS1PrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+}